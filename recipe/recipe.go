@@ -0,0 +1,88 @@
+// Package recipe loads named xo recipes (pattern, formatter, flags and an
+// optional rule predicate) from a YAML rules file, as used by xo's -c/-L
+// flags and its ":name" invocation syntax.
+package recipe
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Recipe is a single named entry in a rules file: the same four pieces as
+// an ordinary xo argument, plus an optional Pre recipe to preprocess input
+// through first.
+type Recipe struct {
+	Description string `yaml:"description"`
+	Pattern     string `yaml:"pattern"`
+	Format      string `yaml:"format"`
+	Flags       string `yaml:"flags"`
+	Rule        string `yaml:"rule"`
+	Pre         string `yaml:"pre"`
+}
+
+// Config is the top-level shape of a rules file.
+type Config struct {
+	Recipes map[string]Recipe `yaml:"recipes"`
+}
+
+// Load reads and parses a rules file.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	return &cfg, nil
+}
+
+// Resolve looks up the recipe named name and substitutes args into its
+// pattern's %1, %2, ... placeholders (regexp-escaped, so args are matched
+// literally rather than as regexp syntax). It returns the chain of recipes
+// to run in order: any Pre recipes first, then name itself last.
+func (c *Config) Resolve(name string, args []string) ([]Recipe, error) {
+	return c.resolve(name, args, nil)
+}
+
+func (c *Config) resolve(name string, args []string, seen []string) ([]Recipe, error) {
+	for _, s := range seen {
+		if s == name {
+			return nil, fmt.Errorf("recipe %q composes with itself", name)
+		}
+	}
+
+	r, ok := c.Recipes[name]
+	if !ok {
+		return nil, fmt.Errorf("no recipe named %q", name)
+	}
+	r.Pattern = substituteArgs(r.Pattern, args)
+
+	var chain []Recipe
+	if r.Pre != "" {
+		pre, err := c.resolve(r.Pre, nil, append(seen, name))
+		if err != nil {
+			return nil, fmt.Errorf("recipe %q: %w", name, err)
+		}
+		chain = pre
+	}
+
+	return append(chain, r), nil
+}
+
+// substituteArgs replaces %1, %2, ... in pattern with the regexp-escaped
+// value of the corresponding arg.
+func substituteArgs(pattern string, args []string) string {
+	for i, arg := range args {
+		placeholder := fmt.Sprintf("%%%d", i+1)
+		pattern = strings.ReplaceAll(pattern, placeholder, regexp.QuoteMeta(arg))
+	}
+	return pattern
+}
@@ -0,0 +1,126 @@
+package recipe
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeRules(t *testing.T, contents string) *Config {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "rules.yml")
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatalf("writing fixture: %v", err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	return cfg
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	if _, err := Load(filepath.Join(t.TempDir(), "nope.yml")); err == nil {
+		t.Error("expected an error for a missing rules file")
+	}
+}
+
+func TestResolveSimple(t *testing.T) {
+	cfg := writeRules(t, `
+recipes:
+  ssh:
+    description: SSH into a server
+    pattern: '.*?(%1):\s*server:\s+([^:\n]+).*'
+    format: '$2'
+    flags: mis
+`)
+
+	chain, err := cfg.Resolve("ssh", []string{"production"})
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if len(chain) != 1 {
+		t.Fatalf("expected a chain of 1 recipe, got %d", len(chain))
+	}
+	want := `.*?(production):\s*server:\s+([^:\n]+).*`
+	if chain[0].Pattern != want {
+		t.Errorf("pattern: got %q, want %q", chain[0].Pattern, want)
+	}
+}
+
+func TestResolveArgsAreRegexpEscaped(t *testing.T) {
+	cfg := writeRules(t, `
+recipes:
+  grep:
+    pattern: '%1'
+    format: '$0'
+`)
+
+	chain, err := cfg.Resolve("grep", []string{"a.b"})
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if want := `a\.b`; chain[0].Pattern != want {
+		t.Errorf("pattern: got %q, want %q (arg should be escaped, not matched as regexp syntax)", chain[0].Pattern, want)
+	}
+}
+
+func TestResolveUnknownRecipe(t *testing.T) {
+	cfg := writeRules(t, `
+recipes:
+  ssh:
+    pattern: 'x'
+    format: '$0'
+`)
+
+	if _, err := cfg.Resolve("nope", nil); err == nil {
+		t.Error("expected an error for an unknown recipe name")
+	}
+}
+
+func TestResolvePreChain(t *testing.T) {
+	cfg := writeRules(t, `
+recipes:
+  extract:
+    pattern: 'user: (\w+)'
+    format: '$1'
+  ssh:
+    pattern: '(.+)'
+    format: '$1'
+    pre: extract
+`)
+
+	chain, err := cfg.Resolve("ssh", nil)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if len(chain) != 2 {
+		t.Fatalf("expected a chain of 2 recipes, got %d", len(chain))
+	}
+	if chain[0].Pattern != `user: (\w+)` {
+		t.Errorf("expected the Pre recipe first, got %+v", chain[0])
+	}
+	if chain[1].Pattern != `(.+)` {
+		t.Errorf("expected the named recipe last, got %+v", chain[1])
+	}
+}
+
+func TestResolveDetectsSelfReference(t *testing.T) {
+	cfg := writeRules(t, `
+recipes:
+  a:
+    pattern: 'x'
+    format: '$0'
+    pre: b
+  b:
+    pattern: 'y'
+    format: '$0'
+    pre: a
+`)
+
+	if _, err := cfg.Resolve("a", nil); err == nil {
+		t.Error("expected an error for a recipe that composes with itself")
+	}
+}
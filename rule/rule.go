@@ -0,0 +1,356 @@
+// Package rule implements the small predicate language that lets an xo
+// invocation constrain or branch on its capture groups without chaining
+// shells, e.g.
+//
+//	where $1 matches "^[A-Z_]+$", $2 != "null"
+package rule
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Predicate is a boolean expression evaluated against a set of capture
+// values. values is keyed by both the positional index of a group ("1",
+// "2", ...) and, for named groups, the group's name, so a predicate can
+// reference a capture the same way the formatter does.
+type Predicate interface {
+	Eval(values map[string]string) bool
+}
+
+// Parse parses a rule expression (the part of an xo argument following
+// "where") into a Predicate.
+func Parse(src string) (Predicate, error) {
+	toks, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{toks: toks}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, fmt.Errorf("unexpected token %q", p.peek().val)
+	}
+
+	return expr, nil
+}
+
+type refPredicate struct {
+	ref  string
+	kind string // "matches", "==", "!=" or "in"
+	arg  string
+	list []string
+	rx   *regexp.Regexp
+}
+
+func (p *refPredicate) Eval(values map[string]string) bool {
+	value := values[p.ref]
+
+	switch p.kind {
+	case "matches":
+		return p.rx.MatchString(value)
+	case "==":
+		return value == p.arg
+	case "!=":
+		return value != p.arg
+	case "in":
+		for _, v := range p.list {
+			if value == v {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+type notPredicate struct{ operand Predicate }
+
+func (p *notPredicate) Eval(values map[string]string) bool { return !p.operand.Eval(values) }
+
+type andPredicate struct{ left, right Predicate }
+
+func (p *andPredicate) Eval(values map[string]string) bool {
+	return p.left.Eval(values) && p.right.Eval(values)
+}
+
+type orPredicate struct{ left, right Predicate }
+
+func (p *orPredicate) Eval(values map[string]string) bool {
+	return p.left.Eval(values) || p.right.Eval(values)
+}
+
+// -- recursive-descent parser --
+//
+// expr    := and ("or" and)*
+// and     := unary (("and" | ",") unary)*
+// unary   := "not" unary | primary
+// primary := "(" expr ")" | comparison
+// comparison := ref ("matches" | "==" | "!=") STRING
+//          | ref "in" "[" STRING ("," STRING)* "]"
+// ref     := "$" (digits | ident)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokRef
+	tokString
+	tokComma
+	tokLParen
+	tokRParen
+	tokLBrack
+	tokRBrack
+	tokEq
+	tokNe
+)
+
+type token struct {
+	kind tokenKind
+	val  string
+}
+
+func tokenize(src string) ([]token, error) {
+	var toks []token
+
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			toks = append(toks, token{tokLParen, "("})
+			i++
+		case c == ')':
+			toks = append(toks, token{tokRParen, ")"})
+			i++
+		case c == '[':
+			toks = append(toks, token{tokLBrack, "["})
+			i++
+		case c == ']':
+			toks = append(toks, token{tokRBrack, "]"})
+			i++
+		case c == ',':
+			toks = append(toks, token{tokComma, ","})
+			i++
+		case c == '=' && i+1 < len(src) && src[i+1] == '=':
+			toks = append(toks, token{tokEq, "=="})
+			i += 2
+		case c == '!' && i+1 < len(src) && src[i+1] == '=':
+			toks = append(toks, token{tokNe, "!="})
+			i += 2
+		case c == '$':
+			j := i + 1
+			for j < len(src) && isWordByte(src[j]) {
+				j++
+			}
+			if j == i+1 {
+				return nil, fmt.Errorf("expected a capture reference after $ at position %d", i)
+			}
+			toks = append(toks, token{tokRef, src[i+1 : j]})
+			i = j
+		case c == '"':
+			val, j, err := scanString(src, i)
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, token{tokString, val})
+			i = j
+		case isAlphaByte(c):
+			j := i
+			for j < len(src) && isWordByte(src[j]) {
+				j++
+			}
+			toks = append(toks, token{tokIdent, src[i:j]})
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected character %q at position %d", c, i)
+		}
+	}
+
+	toks = append(toks, token{tokEOF, ""})
+	return toks, nil
+}
+
+// scanString reads a double-quoted string literal starting at src[start]
+// and returns its unescaped value along with the index just past the
+// closing quote.
+func scanString(src string, start int) (string, int, error) {
+	var b strings.Builder
+
+	j := start + 1
+	for j < len(src) && src[j] != '"' {
+		if src[j] == '\\' && j+1 < len(src) {
+			b.WriteByte(src[j+1])
+			j += 2
+			continue
+		}
+		b.WriteByte(src[j])
+		j++
+	}
+	if j >= len(src) {
+		return "", 0, fmt.Errorf("unterminated string literal")
+	}
+
+	return b.String(), j + 1, nil
+}
+
+func isAlphaByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isWordByte(c byte) bool {
+	return isAlphaByte(c) || (c >= '0' && c <= '9')
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek() token { return p.toks[p.pos] }
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	p.pos++
+	return t
+}
+
+func (p *parser) parseOr() (Predicate, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind == tokIdent && p.peek().val == "or" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orPredicate{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Predicate, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for (p.peek().kind == tokIdent && p.peek().val == "and") || p.peek().kind == tokComma {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &andPredicate{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Predicate, error) {
+	if p.peek().kind == tokIdent && p.peek().val == "not" {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notPredicate{operand}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Predicate, error) {
+	if p.peek().kind == tokLParen {
+		p.next()
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != tokRParen {
+			return nil, fmt.Errorf("expected a closing parenthesis")
+		}
+		p.next()
+		return expr, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (Predicate, error) {
+	ref := p.next()
+	if ref.kind != tokRef {
+		return nil, fmt.Errorf(`expected a capture reference (e.g. $1 or $name), got %q`, ref.val)
+	}
+
+	op := p.next()
+	switch {
+	case op.kind == tokIdent && op.val == "matches":
+		str := p.next()
+		if str.kind != tokString {
+			return nil, fmt.Errorf("expected a quoted regular expression after matches")
+		}
+		rx, err := regexp.Compile(str.val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression in matches predicate: %w", err)
+		}
+		return &refPredicate{ref: ref.val, kind: "matches", rx: rx}, nil
+
+	case op.kind == tokEq:
+		str := p.next()
+		if str.kind != tokString {
+			return nil, fmt.Errorf("expected a quoted string after ==")
+		}
+		return &refPredicate{ref: ref.val, kind: "==", arg: str.val}, nil
+
+	case op.kind == tokNe:
+		str := p.next()
+		if str.kind != tokString {
+			return nil, fmt.Errorf("expected a quoted string after !=")
+		}
+		return &refPredicate{ref: ref.val, kind: "!=", arg: str.val}, nil
+
+	case op.kind == tokIdent && op.val == "in":
+		if p.peek().kind != tokLBrack {
+			return nil, fmt.Errorf("expected [ after in")
+		}
+		p.next()
+
+		var list []string
+		for {
+			str := p.next()
+			if str.kind != tokString {
+				return nil, fmt.Errorf("expected a quoted string in the in [...] list")
+			}
+			list = append(list, str.val)
+
+			if p.peek().kind == tokComma {
+				p.next()
+				continue
+			}
+			break
+		}
+
+		if p.peek().kind != tokRBrack {
+			return nil, fmt.Errorf("expected a closing ] after the in [...] list")
+		}
+		p.next()
+
+		return &refPredicate{ref: ref.val, kind: "in", list: list}, nil
+
+	default:
+		return nil, fmt.Errorf("expected matches, ==, != or in after $%s, got %q", ref.val, op.val)
+	}
+}
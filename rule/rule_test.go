@@ -0,0 +1,102 @@
+package rule
+
+import "testing"
+
+func eval(t *testing.T, src string, values map[string]string) bool {
+	t.Helper()
+	pred, err := Parse(src)
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", src, err)
+	}
+	return pred.Eval(values)
+}
+
+func TestParseMatches(t *testing.T) {
+	if !eval(t, `$1 matches "^[A-Z_]+$"`, map[string]string{"1": "FOO_BAR"}) {
+		t.Error("expected match")
+	}
+	if eval(t, `$1 matches "^[A-Z_]+$"`, map[string]string{"1": "foo"}) {
+		t.Error("expected no match")
+	}
+}
+
+func TestParseNamedRef(t *testing.T) {
+	if !eval(t, `$name == "deploy"`, map[string]string{"name": "deploy"}) {
+		t.Error("expected named ref to match")
+	}
+}
+
+func TestParseEqNe(t *testing.T) {
+	if !eval(t, `$2 == "5"`, map[string]string{"2": "5"}) {
+		t.Error("expected == to hold")
+	}
+	if eval(t, `$2 == "null"`, map[string]string{"2": "5"}) {
+		t.Error("expected == to fail")
+	}
+	if !eval(t, `$2 != "null"`, map[string]string{"2": "5"}) {
+		t.Error("expected != to hold")
+	}
+	if eval(t, `$2 != "null"`, map[string]string{"2": "null"}) {
+		t.Error("expected != to fail")
+	}
+}
+
+func TestParseIn(t *testing.T) {
+	if !eval(t, `$1 in ["a", "b", "c"]`, map[string]string{"1": "b"}) {
+		t.Error("expected value in list")
+	}
+	if eval(t, `$1 in ["a", "b", "c"]`, map[string]string{"1": "z"}) {
+		t.Error("expected value not in list")
+	}
+}
+
+func TestParseNot(t *testing.T) {
+	if !eval(t, `not $1 == "x"`, map[string]string{"1": "y"}) {
+		t.Error("expected not to negate")
+	}
+}
+
+func TestParseAndOr(t *testing.T) {
+	values := map[string]string{"1": "FOO", "2": "5"}
+	if !eval(t, `$1 matches "^[A-Z]+$" and $2 != "null"`, values) {
+		t.Error("expected and to hold")
+	}
+	if !eval(t, `$1 == "nope" or $2 == "5"`, values) {
+		t.Error("expected or to hold")
+	}
+	if !eval(t, `$1 matches "^[A-Z]+$", $2 != "null"`, values) {
+		t.Error("expected comma to behave like and")
+	}
+}
+
+func TestParseParens(t *testing.T) {
+	values := map[string]string{"1": "a", "2": "b"}
+	if !eval(t, `($1 == "a" or $1 == "z") and $2 == "b"`, values) {
+		t.Error("expected parenthesized precedence to hold")
+	}
+}
+
+func TestParseEscapedStringLiteral(t *testing.T) {
+	if !eval(t, `$1 == "with \"quotes\""`, map[string]string{"1": `with "quotes"`}) {
+		t.Error("expected escaped quote to round-trip")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := []string{
+		``,
+		`$1`,
+		`$1 matches`,
+		`$1 == foo`,
+		`$1 in [`,
+		`$`,
+		`$1 frobnicates "x"`,
+		`(`,
+		`$1 == "unterminated`,
+	}
+	for _, src := range cases {
+		if _, err := Parse(src); err == nil {
+			t.Errorf("Parse(%q): expected an error, got none", src)
+		}
+	}
+}
@@ -5,25 +5,57 @@ formats the regexp matches.
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"regexp"
+	"sort"
+	"strings"
 	"unicode/utf8"
 
 	"github.com/xplshn/a-utils/pkg/ccmd"
+	"github.com/xplshn/xo/recipe"
+	"github.com/xplshn/xo/rule"
 )
 
 func main() {
-cmdInfo := &ccmd.CmdInfo{
+	var (
+		lineMode      bool
+		passthrough   bool
+		elseFormatter string
+		configPath    string
+		listRecipes   bool
+		inPlace       bool
+		inPlaceSuffix string
+		stdoutMode    bool
+	)
+
+	// -i accepts an optional attached suffix (-i, -i.bak, ...), like sed -i,
+	// which the flag package can't express directly, so pull it out of
+	// os.Args before flag.Parse sees it.
+	os.Args, inPlace, inPlaceSuffix = extractInPlaceFlag(os.Args)
+
+	flag.BoolVar(&lineMode, "l", false, "Read stdin line-by-line, formatting each line as it arrives instead of slurping all input")
+	flag.BoolVar(&lineMode, "line", false, "Read stdin line-by-line, formatting each line as it arrives instead of slurping all input")
+	flag.BoolVar(&passthrough, "p", false, "With -l, print non-matching lines unchanged instead of suppressing them")
+	flag.BoolVar(&passthrough, "passthrough", false, "With -l, print non-matching lines unchanged instead of suppressing them")
+	flag.StringVar(&elseFormatter, "else", "", "Formatter to use for matches rejected by a `where` rule, instead of dropping them")
+	flag.StringVar(&configPath, "c", "~/.config/xo/rules.yml", "Rules file to load named recipes from, for use with the `:name` argument form")
+	flag.BoolVar(&listRecipes, "L", false, "List the recipes available in the rules file and exit")
+	flag.BoolVar(&stdoutMode, "stdout", false, "With files given after the pattern, write the transformed file(s) to stdout instead of editing in place")
+
+	cmdInfo := &ccmd.CmdInfo{
 		Name:        "xo",
 		Authors:     []string{"ezekg", "xplshn"},
 		Repository:  "https://github.com/xplshn/xo",
 		Description: "Utility that composes regular expression matches",
-		Synopsis:    "'/<pattern>/<formatter>/[flags]'",
+		Synopsis:    "[-i[SUFFIX]|-stdout] '/<pattern>/<formatter>/[flags]' [file ...]",
 		CustomFields: map[string]interface{}{
 			"1_Examples": `Let's start off a little simple, and then we'll ramp it up and get crazy. xo, in its simplest form, does things like this,
 	  \echo 'Hello! My name is C3PO, human cyborg relations.' | xo '/^(\w+)?! my name is (\w+)/$1, $2!/i'
@@ -92,12 +124,28 @@ cmdInfo := &ccmd.CmdInfo{
 	  \cat secrets/*.yml | xo '/test_secret_key:\s([\w]+).*?test_publishable_key:\s([\w]+)/PUBLISHABLE_KEY=$1 SECRET_KEY=$2 rails s/mis' | sh
     Pretty cool, huh?
 `,
-			"2_Fallback values": `You may specify fallback values for matches using the elvis operator,
-    $i?:value, where i is the index that you want to assign the fallback value to.
+			"2_Named groups": `Capturing groups may be named using the regexp syntax (?P<name>...), and referenced in the
+    formatter as $name or ${name} instead of a positional $i. Named and positional references may be mixed freely,
+    and both still refer to the same underlying submatch,
+	  \echo 'Hello! My name is C3PO.' | xo '/^(?P<greeting>\w+)! my name is (?P<name>\w+)/$greeting, ${name}!/i'
+	  \# =>
+	  \#  Hello, C3PO!
+    Use ${name} instead of $name when the formatter needs a character immediately after the name that would
+    otherwise be read as part of it.`,
+			"3_Fallback values": `You may specify fallback values for matches using the elvis operator,
+    $i?:value, where i is the index (or $name?:value / ${name}?:value, where name is a named group) that you want
+    to assign the fallback value to.
     The fallback value may contain any sequence of characters, though anything other than letters,
     numbers, dashes and underscores must be escaped; it may also contain other match group indices
     if they are in descending order e.g. $2?:$1, not $1?:$2.`,
-			"3_Delimiters": `You may substitute / for any delimiter. If the delimiter is found within your pattern or formatter, it must be escaped.
+			"4_Rules": `You can constrain or branch on captures by appending a "where" clause after your formatter (and flags, if
+    any), so matches that don't satisfy it are skipped instead of chaining the output through a shell filter,
+	  \xo '/(\w+)=(\w+)/$1 -> $2/ where $1 matches "^[A-Z_]+$", $2 != "null"'
+    Predicates are $ref matches "regex", $ref == "value", $ref != "value" and $ref in ["a", "b", "c"], where ref
+    is a positional $i or a named group. They combine with and, or, not and parentheses; a comma is shorthand
+    for and. Matches that fail the rule are dropped unless -else FORMATTER is given, in which case they're
+    formatted with FORMATTER instead.`,
+			"5_Delimiters": `You may substitute / for any delimiter. If the delimiter is found within your pattern or formatter, it must be escaped.
     If it would normally be escaped in your pattern or formatter, it must be escaped again. For example,
 	\# Using the delimiter '|',
 	\echo 'Hello! My name is C3PO, human cyborg relations.' | xo '|^(\w+)?! my name is (\w+)|$1, $2!|i'
@@ -105,7 +153,45 @@ cmdInfo := &ccmd.CmdInfo{
 	\# Using the delimiter 'w',
 	\echo 'Hello! My name is C3PO, human cyborg relations.' | xo 'w^(\\w+)?! my name is (\\w+)w$1, $2!wi'
 `,
-			"4_Notes":    "![Go Regular Expressions reference sheet](https://golang.org/pkg/regexp/syntax)",
+			"6_Notes": "![Go Regular Expressions reference sheet](https://golang.org/pkg/regexp/syntax)",
+			"7_Streaming": `By default, xo reads all of stdin before formatting any output, which is fine for files but blocks forever on
+    an open stream. Pass -l/--line to switch to streaming mode: each line of stdin is matched and formatted as soon
+    as it arrives, which is handy for tailing logs,
+	  \tail -f app.log | xo -l '/ERROR (\w+): (.*)/[$1] $2/'
+    Lines that don't match are suppressed by default, just like when reading a whole file. Pass -p/--passthrough to
+    print them unchanged instead, so the stream keeps flowing even for lines you're not reformatting.`,
+			"8_Recipes": `Instead of retyping a giant pattern every time, save it as a named recipe in a rules file (-c defaults to
+    ~/.config/xo/rules.yml) and invoke it with :name,
+	  \recipes:
+	  \  ssh:
+	  \    description: SSH into a server by stage name
+	  \    pattern: '.*?(%1):\s*server:\s+([^:\n]+):?(\d+)?.*?user:\s+([^\n]+).*'
+	  \    format: '$4@$2 -p $3?:22'
+	  \    flags: mis
+	  \
+	  \ssh $(xo :ssh production < servers.yml)
+    Extra arguments after :name (production, above) are substituted into the recipe's pattern wherever it contains
+    %1, %2, and so on, escaped so they're matched literally rather than as regexp syntax. A recipe may also set
+    pre to the name of another recipe, whose own output becomes this recipe's input, letting recipes compose.
+    Run xo -L to list the recipes available in the rules file along with their descriptions.`,
+			"9_In-place editing": `With -i (or -stdout) and one or more files given as positional arguments after your xo expression, xo
+    edits them instead of reading stdin, like sed -i; without either flag, such files are ignored and stdin is read,
+	  \xo -i '/foo/bar/' src/main.go
+	  \xo -i.bak '/foo/bar/' src/main.go   # keep the original as src/main.go.bak
+	  \xo -stdout '/foo/bar/' src/main.go  # write the transformed file to stdout, leaving it untouched on disk
+    Unlike the default mode, which only prints the formatted matches, -i and -stdout preserve every byte that
+    didn't match, so the rest of the file is untouched. File arguments may use glob patterns, including a
+    recursive ** component that filepath.Glob doesn't support on its own, e.g. src/**/*.go.`,
+			"10_Extended patterns": `Add the x flag alongside i/m/s to write your pattern PCRE-style "extended": unescaped whitespace
+    is ignored and # starts a line comment, so a complex pattern like the servers.yml example above can be spread
+    out and documented instead of staying a single opaque line,
+	  \xo '/
+	  \  .*?(production):\s*server:\s+  # stage name and server host
+	  \  ([^:\n]+):?(\d+)?              # optional port
+	  \  .*?user:\s+([^\n]+).*          # ssh user
+	  \/$4@$2 -p $3?:22/misx' < servers.yml
+    A literal space can still be matched with \ (an escaped space), and whitespace inside a [...] character
+    class is always kept, since neither is ever insignificant the way padding and comments are.`,
 		},
 	}
 
@@ -120,6 +206,15 @@ cmdInfo := &ccmd.CmdInfo{
 
 	flag.Parse()
 
+	if listRecipes {
+		cfg, err := recipe.Load(expandHome(configPath))
+		if err != nil {
+			exitWithError("Failed to load rules file", err.Error())
+		}
+		printRecipes(cfg)
+		return
+	}
+
 	// Check if no arguments were provided
 	if flag.NArg() == 0 {
 		flag.Usage()
@@ -127,11 +222,66 @@ cmdInfo := &ccmd.CmdInfo{
 	}
 
 	arg := flag.Arg(0) // Get the first argument after parsing
+
+	if inPlace || stdoutMode {
+		if flag.NArg() < 2 {
+			exitWithError("No files specified (required with -i/-stdout)")
+		}
+
+		pattern, format, flags, ruleSrc := parseExpr(arg)
+		fileArgs := flag.Args()[1:]
+		if len(fileArgs) > 0 && fileArgs[0] == "--" {
+			// flag.Parse stops at the expression, its first non-flag
+			// argument, so a sed-style "--" protecting a filename like
+			// -weird.txt from being read as a flag ends up here rather
+			// than being consumed by flag.Parse itself.
+			fileArgs = fileArgs[1:]
+		}
+		files, err := expandGlobs(fileArgs)
+		if err != nil {
+			exitWithError("Failed to expand file arguments", err.Error())
+		}
+		if len(files) == 0 {
+			exitWithError("No files matched")
+		}
+
+		substituteFiles(compilePattern(pattern, flags), format, ruleSrc, elseFormatter, files, inPlace, inPlaceSuffix, stdoutMode)
+		return
+	}
+
 	stat, _ := os.Stdin.Stat()
 	if (stat.Mode() & os.ModeCharDevice) != 0 {
 		exitWithError("Nothing passed to stdin")
 	}
 
+	if name, ok := strings.CutPrefix(arg, ":"); ok {
+		cfg, err := recipe.Load(expandHome(configPath))
+		if err != nil {
+			exitWithError("Failed to load rules file", err.Error())
+		}
+
+		chain, err := cfg.Resolve(name, flag.Args()[1:])
+		if err != nil {
+			exitWithError("Invalid recipe", err.Error())
+		}
+
+		data, _ := io.ReadAll(os.Stdin)
+		for _, step := range chain[:len(chain)-1] {
+			data = renderAll(data, compilePattern(step.Pattern, step.Flags), step.Format)
+		}
+
+		final := chain[len(chain)-1]
+		run(bytes.NewReader(data), compilePattern(final.Pattern, final.Flags), final.Format, final.Rule, lineMode, passthrough, elseFormatter)
+		return
+	}
+
+	pattern, format, flags, ruleSrc := parseExpr(arg)
+	run(os.Stdin, compilePattern(pattern, flags), format, ruleSrc, lineMode, passthrough, elseFormatter)
+}
+
+// parseExpr splits an xo argument of the form "<delim>pattern<delim>format<delim>[flags][ where rule]"
+// into its pattern, format, flags and rule pieces.
+func parseExpr(arg string) (pattern, format, flags, ruleSrc string) {
 	parts, err := split(arg)
 	if err != nil {
 		exitWithError("Invalid argument string")
@@ -143,63 +293,471 @@ cmdInfo := &ccmd.CmdInfo{
 		exitWithError("Extra delimiter detected (maybe try one other than `/`)")
 	}
 
-	pattern, format, flags := parts[0], parts[1], ""
+	pattern, format = parts[0], parts[1]
 	if len(parts) > 2 {
 		flags = parts[2]
-		pattern = fmt.Sprintf(`(?%s)%s`, flags, pattern)
+		if m := ruleClauseRx.FindStringSubmatch(flags); m != nil {
+			flags, ruleSrc = m[1], m[2]
+		}
+	}
+
+	return pattern, format, flags, ruleSrc
+}
+
+// compilePattern returns the final regexp source for pattern given flags.
+// An x flag enables PCRE-style extended mode (unescaped whitespace and #
+// comments in pattern are stripped before compiling, since Go's regexp
+// package has no native support for it); the remaining flags, if any, are
+// then applied the usual way.
+func compilePattern(pattern, flags string) string {
+	if strings.ContainsRune(flags, 'x') {
+		pattern = stripExtended(pattern)
+		flags = strings.ReplaceAll(flags, "x", "")
+	}
+	return withFlags(pattern, flags)
+}
+
+// withFlags wraps pattern in a (?flags) prefix, as used by Go's regexp
+// syntax to set inline flags, unless flags is empty.
+func withFlags(pattern, flags string) string {
+	if flags == "" {
+		return pattern
+	}
+	return fmt.Sprintf(`(?%s)%s`, flags, pattern)
+}
+
+// stripExtended removes unescaped whitespace and "# ..." line comments from
+// pattern, outside of character classes ([...]) and backslash escapes
+// (so "\ " still matches a literal space), implementing PCRE/Perl's
+// extended ("x") mode. A POSIX bracket expression nested inside a class
+// ([:alpha:], [.ch.], [=a=]) is copied through verbatim, since its "]"
+// doesn't close the outer class.
+func stripExtended(pattern string) string {
+	var b strings.Builder
+
+	inClass, classStart := false, false
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+
+		if c == '\\' && i+1 < len(pattern) {
+			b.WriteByte(c)
+			b.WriteByte(pattern[i+1])
+			i++
+			classStart = false
+			continue
+		}
+
+		if inClass {
+			if c == '[' && i+1 < len(pattern) && strings.ContainsRune(":.=", rune(pattern[i+1])) {
+				delim := pattern[i+1]
+				end := strings.Index(pattern[i+2:], string(delim)+"]")
+				if end >= 0 {
+					end += i + 2
+					b.WriteString(pattern[i : end+2])
+					i = end + 1
+					classStart = false
+					continue
+				}
+			}
+			b.WriteByte(c)
+			if classStart && c == '^' {
+				continue // leading negation marker, class has not started yet
+			}
+			if c == ']' && !classStart {
+				inClass = false
+			}
+			classStart = false
+			continue
+		}
+
+		switch {
+		case c == '[':
+			inClass, classStart = true, true
+			b.WriteByte(c)
+		case c == '#':
+			for i < len(pattern) && pattern[i] != '\n' {
+				i++
+			}
+			i-- // re-examine the newline itself next iteration
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			// skip unescaped whitespace
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
+
+// expandHome expands a leading ~ in path to the current user's home
+// directory, leaving path unchanged if it doesn't start with one.
+func expandHome(path string) string {
+	home, err := os.UserHomeDir()
+	if err != nil || !strings.HasPrefix(path, "~") {
+		return path
+	}
+	return home + strings.TrimPrefix(path, "~")
+}
+
+// printRecipes prints the name and description of every recipe in cfg.
+func printRecipes(cfg *recipe.Config) {
+	names := make([]string, 0, len(cfg.Recipes))
+	for name := range cfg.Recipes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Printf("%s\t%s\n", name, cfg.Recipes[name].Description)
+	}
+}
+
+// renderAll compiles pattern, formats every match it finds in data with
+// format, and returns the results joined by newlines. It's used to run a
+// recipe's Pre stages, whose output becomes the next stage's input.
+func renderAll(data []byte, pattern, format string) []byte {
+	rx, err := regexp.Compile(pattern)
+	if err != nil {
+		exitWithError("Invalid regular expression", err.Error())
 	}
 
+	names := rx.SubexpNames()
+	fallbacks := make(map[string]string)
+
+	matches := rx.FindAllSubmatchIndex(data, -1)
+	if matches == nil {
+		exitWithError("No matches found")
+	}
+
+	var buf bytes.Buffer
+	for _, loc := range matches {
+		buf.WriteString(formatMatch(data, loc, names, format, fallbacks))
+		buf.WriteByte('\n')
+	}
+
+	return buf.Bytes()
+}
+
+// run compiles pattern and, for every match found in in, prints it
+// formatted with format (subject to ruleSrc and elseFormatter, see
+// printMatch). In lineMode, in is read and matched line-by-line as it
+// arrives instead of being slurped in full first.
+func run(in io.Reader, pattern, format, ruleSrc string, lineMode, passthrough bool, elseFormatter string) {
 	rx, err := regexp.Compile(pattern)
 	if err != nil {
 		exitWithError("Invalid regular expression")
 	}
 
-	in, _ := io.ReadAll(os.Stdin)
-	matches := rx.FindAllSubmatch(in, -1)
+	var pred rule.Predicate
+	if ruleSrc != "" {
+		pred, err = rule.Parse(ruleSrc)
+		if err != nil {
+			exitWithError("Invalid rule", err.Error())
+		}
+	}
+
+	names := rx.SubexpNames()
+	fallbacks := make(map[string]string)
+
+	if lineMode {
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+		for scanner.Scan() {
+			line := scanner.Bytes()
+			matches := rx.FindAllSubmatchIndex(line, -1)
+			if matches == nil {
+				if passthrough {
+					fmt.Println(string(line))
+				}
+				continue
+			}
+
+			for _, loc := range matches {
+				printMatch(line, loc, names, format, elseFormatter, pred, fallbacks)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			exitWithError("Failed to read stdin", err.Error())
+		}
+		return
+	}
+
+	data, _ := io.ReadAll(in)
+	matches := rx.FindAllSubmatchIndex(data, -1)
 	if matches == nil {
 		exitWithError("No matches found")
 	}
 
-	fallbacks := make(map[int]string)
+	for _, loc := range matches {
+		printMatch(data, loc, names, format, elseFormatter, pred, fallbacks)
+	}
+}
+
+// extractInPlaceFlag pulls a sed-style -i or -i<suffix> argument out of
+// args, since the flag package has no way to express a flag whose value is
+// optional and, when present, directly attached. It returns the remaining
+// arguments (with argv[0] preserved), whether -i was present, and its
+// suffix, if any.
+func extractInPlaceFlag(args []string) (remaining []string, inPlace bool, suffix string) {
+	remaining = append(remaining, args[0])
+
+	for i, a := range args[1:] {
+		switch {
+		case a == "--":
+			// Everything from "--" on is an operand, so a file named like
+			// -i.txt is never taken for the flag.
+			return append(remaining, args[1+i:]...), inPlace, suffix
+		case a == "-i":
+			inPlace = true
+		case strings.HasPrefix(a, "-i") && !strings.HasPrefix(a, "-i="):
+			inPlace = true
+			suffix = strings.TrimPrefix(a, "-i")
+		default:
+			remaining = append(remaining, a)
+		}
+	}
+
+	return remaining, inPlace, suffix
+}
+
+// expandGlobs expands each of patterns into the file paths it matches,
+// supporting a "**" component for recursive matching (e.g. src/**/*.go) in
+// addition to the single-directory wildcards filepath.Glob understands.
+// Patterns without any wildcard are passed through unchanged.
+func expandGlobs(patterns []string) ([]string, error) {
+	var files []string
+
+	for _, pattern := range patterns {
+		if !strings.ContainsAny(pattern, "*?[") {
+			files = append(files, pattern)
+			continue
+		}
+
+		matches, err := globDoubleStar(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", pattern, err)
+		}
+		files = append(files, matches...)
+	}
+
+	return files, nil
+}
+
+func globDoubleStar(pattern string) ([]string, error) {
+	if !strings.Contains(pattern, "**") {
+		return filepath.Glob(pattern)
+	}
+
+	root, suffix, _ := strings.Cut(pattern, "**")
+	root = strings.TrimSuffix(root, string(filepath.Separator))
+	if root == "" {
+		root = "."
+	}
+	suffix = strings.TrimPrefix(suffix, string(filepath.Separator))
+
+	var matches []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if ok, err := filepath.Match(suffix, filepath.Base(path)); err != nil {
+			return err
+		} else if ok {
+			matches = append(matches, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return matches, nil
+}
+
+// substituteFiles runs pattern/format/ruleSrc over each file in files,
+// preserving non-matching regions verbatim (unlike run, which only prints
+// the formatted matches and discards the rest). With inPlace, each file is
+// rewritten, optionally after being backed up with suffix appended to its
+// name; with stdoutMode, the transformed contents are written to stdout
+// instead of touching disk.
+func substituteFiles(pattern, format, ruleSrc, elseFormatter string, files []string, inPlace bool, suffix string, stdoutMode bool) {
+	rx, err := regexp.Compile(pattern)
+	if err != nil {
+		exitWithError("Invalid regular expression")
+	}
+
+	var pred rule.Predicate
+	if ruleSrc != "" {
+		pred, err = rule.Parse(ruleSrc)
+		if err != nil {
+			exitWithError("Invalid rule", err.Error())
+		}
+	}
 
-	for _, group := range matches {
-		result := format
+	names := rx.SubexpNames()
+	fallbacks := make(map[string]string)
 
-		for i, match := range group {
-			value := string(match)
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			exitWithError("Failed to read file", err.Error())
+		}
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			exitWithError("Failed to read file", err.Error())
+		}
 
-			rxFallback, err := regexp.Compile(fmt.Sprintf(`(\$%d)\?:(([-_A-Za-z0-9]((\\.)+)?)+)`, i))
-			if err != nil {
-				exitWithError("Failed to parse default arguments", err.Error())
+		out := substitute(data, rx, names, format, elseFormatter, pred, fallbacks)
+
+		if stdoutMode {
+			os.Stdout.Write(out)
+			continue
+		}
+
+		if suffix != "" {
+			if err := os.WriteFile(file+suffix, data, info.Mode().Perm()); err != nil {
+				exitWithError("Failed to write backup file", err.Error())
 			}
+		}
+		if err := os.WriteFile(file, out, info.Mode().Perm()); err != nil {
+			exitWithError("Failed to write file", err.Error())
+		}
+	}
+}
 
-			// Remove extraneous escapes. This is done because Go doesn't support
-			// lookbehinds, i.e. `(\$%d)\?:(([-_A-za-z0-9]|(?<=\\).)+)`, so we have
-			// to match escaped fallback characters using the regexp above, which
-			// matches backslashes as well as the escaped character.
-			rxEsc, _ := regexp.Compile(`\\(.)`)
-
-			fallback := rxFallback.FindStringSubmatch(result)
-			if len(fallback) > 1 {
-				// Store fallback values if key does not already exist
-				if _, ok := fallbacks[i]; !ok {
-					fallbacks[i] = rxEsc.ReplaceAllString(fallback[2], "$1")
-				}
-				result = rxFallback.ReplaceAllString(result, "$1")
+// substitute returns data with every match of rx replaced by its formatted
+// text (or left unchanged if a rule rejects it and no elseFormatter is
+// given), preserving all non-matching bytes verbatim.
+func substitute(data []byte, rx *regexp.Regexp, names []string, format, elseFormatter string, pred rule.Predicate, fallbacks map[string]string) []byte {
+	matches := rx.FindAllSubmatchIndex(data, -1)
+	if matches == nil {
+		return data
+	}
+
+	var buf bytes.Buffer
+	last := 0
+	for _, loc := range matches {
+		buf.Write(data[last:loc[0]])
+
+		replacement := format
+		if pred != nil && !pred.Eval(captureValues(data, loc, names)) {
+			if elseFormatter == "" {
+				buf.Write(data[loc[0]:loc[1]])
+				last = loc[1]
+				continue
 			}
+			replacement = elseFormatter
+		}
+
+		buf.WriteString(formatMatch(data, loc, names, replacement, fallbacks))
+		last = loc[1]
+	}
+	buf.Write(data[last:])
 
-			// Set default for empty values
-			if value == "" {
-				value = fallbacks[i]
+	return buf.Bytes()
+}
+
+// ruleClauseRx splits a trailing "where <rule>" clause off of the flags
+// segment of an xo argument, e.g. "i where $1 != \"null\"" -> ("i", "$1 != \"null\"").
+var ruleClauseRx = regexp.MustCompile(`(?s)^(\w*)\s+where\s+(.+)$`)
+
+// printMatch evaluates pred (if any) against loc's captures and prints the
+// match formatted with format, or with elseFormatter if pred rejects it.
+// A nil pred always formats with format. An empty elseFormatter drops
+// rejected matches, same as a plain non-match.
+func printMatch(in []byte, loc []int, names []string, format, elseFormatter string, pred rule.Predicate, fallbacks map[string]string) {
+	if pred != nil && !pred.Eval(captureValues(in, loc, names)) {
+		if elseFormatter != "" {
+			fmt.Println(formatMatch(in, loc, names, elseFormatter, fallbacks))
+		}
+		return
+	}
+
+	fmt.Println(formatMatch(in, loc, names, format, fallbacks))
+}
+
+// captureValues builds the values map a rule.Predicate evaluates against,
+// keyed by both the positional index of a group ("1", "2", ...) and, for
+// named groups, the group's name.
+func captureValues(in []byte, loc []int, names []string) map[string]string {
+	values := make(map[string]string, len(loc)/2)
+
+	for i := 0; i < len(loc)/2; i++ {
+		start, end := loc[2*i], loc[2*i+1]
+		value := ""
+		if start >= 0 && end >= 0 {
+			value = string(in[start:end])
+		}
+
+		values[fmt.Sprintf("%d", i)] = value
+		if names[i] != "" {
+			values[names[i]] = value
+		}
+	}
+
+	return values
+}
+
+// formatMatch substitutes the submatches of a single match (loc, as returned
+// by FindSubmatchIndex) into format, resolving $i/$name?:fallback defaults
+// against the shared fallbacks map so that a fallback set by an earlier
+// match still applies to later ones. names is rx.SubexpNames(), used to
+// resolve named group references ($name or ${name}) alongside positional
+// ones ($i).
+func formatMatch(in []byte, loc []int, names []string, format string, fallbacks map[string]string) string {
+	result := format
+
+	for i := 0; i < len(loc)/2; i++ {
+		start, end := loc[2*i], loc[2*i+1]
+		value := ""
+		if start >= 0 && end >= 0 {
+			value = string(in[start:end])
+		}
+
+		name := names[i]
+		key := fmt.Sprintf("%d", i)
+		ref := fmt.Sprintf(`\$%d`, i)
+		if name != "" {
+			key = name
+			ref = fmt.Sprintf(`(?:\$%d|\$%s\b|\$\{%s\})`, i, regexp.QuoteMeta(name), regexp.QuoteMeta(name))
+		}
+
+		rxFallback, err := regexp.Compile(fmt.Sprintf(`(%s)\?:(([-_A-Za-z0-9]((\\.)+)?)+)`, ref))
+		if err != nil {
+			exitWithError("Failed to parse default arguments", err.Error())
+		}
+
+		// Remove extraneous escapes. This is done because Go doesn't support
+		// lookbehinds, i.e. `(\$%d)\?:(([-_A-za-z0-9]|(?<=\\).)+)`, so we have
+		// to match escaped fallback characters using the regexp above, which
+		// matches backslashes as well as the escaped character.
+		rxEsc, _ := regexp.Compile(`\\(.)`)
+
+		fallback := rxFallback.FindStringSubmatch(result)
+		if len(fallback) > 1 {
+			// Store fallback values if key does not already exist
+			if _, ok := fallbacks[key]; !ok {
+				fallbacks[key] = rxEsc.ReplaceAllString(fallback[2], "$1")
 			}
+			result = rxFallback.ReplaceAllString(result, "$1")
+		}
 
-			// Replace values
-			rxRepl, _ := regexp.Compile(fmt.Sprintf(`\$%d`, i))
-			result = rxRepl.ReplaceAllString(result, value)
+		// Set default for empty values
+		if value == "" {
+			value = fallbacks[key]
 		}
 
-		fmt.Println(result)
+		// Replace values
+		rxRepl := regexp.MustCompile(ref)
+		result = rxRepl.ReplaceAllString(result, value)
 	}
+
+	return result
 }
 
 // split slices str into all substrings separated by non-escaped values of the
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestStripExtendedWhitespaceAndComments(t *testing.T) {
+	got := stripExtended("  (\\w+)  # a comment\n  (\\d+) \t\n")
+	want := `(\w+)(\d+)`
+	if got != want {
+		t.Errorf("stripExtended: got %q, want %q", got, want)
+	}
+}
+
+func TestStripExtendedEscapedSpace(t *testing.T) {
+	got := stripExtended(`a\ b  c`)
+	want := `a\ bc`
+	if got != want {
+		t.Errorf("stripExtended: got %q, want %q", got, want)
+	}
+}
+
+func TestStripExtendedKeepsWhitespaceInClass(t *testing.T) {
+	got := stripExtended(`[a b]  c`)
+	want := `[a b]c`
+	if got != want {
+		t.Errorf("stripExtended: got %q, want %q", got, want)
+	}
+}
+
+func TestStripExtendedNegatedClass(t *testing.T) {
+	got := stripExtended(`[^ \n]  +`)
+	want := `[^ \n]+`
+	if got != want {
+		t.Errorf("stripExtended: got %q, want %q", got, want)
+	}
+}
+
+func TestStripExtendedLiteralClosingBracketFirst(t *testing.T) {
+	got := stripExtended(`[]abc]  +`)
+	want := `[]abc]+`
+	if got != want {
+		t.Errorf("stripExtended: got %q, want %q", got, want)
+	}
+}
+
+func TestStripExtendedPosixClass(t *testing.T) {
+	got := stripExtended("[[:alpha:] _]  +")
+	want := `[[:alpha:] _]+`
+	if got != want {
+		t.Errorf("stripExtended: got %q, want %q", got, want)
+	}
+}
+
+func TestStripExtendedPosixClassHashDoesNotLeak(t *testing.T) {
+	// A "#" right after a [:...:] token is still inside the outer class,
+	// since the token's own "]" does not close it, so it must not be
+	// mistaken for a comment.
+	got := stripExtended("[[:alpha:]#]  +")
+	want := `[[:alpha:]#]+`
+	if got != want {
+		t.Errorf("stripExtended: got %q, want %q", got, want)
+	}
+}
+
+func TestStripExtendedCompilesAndMatches(t *testing.T) {
+	pattern := stripExtended(`
+		^([[:alpha:] _]+)$  # only letters, spaces and underscores
+	`)
+	rx, err := regexp.Compile(pattern)
+	if err != nil {
+		t.Fatalf("compiling stripped pattern %q: %v", pattern, err)
+	}
+	if !rx.MatchString("ab cd") {
+		t.Errorf("pattern %q should match %q", pattern, "ab cd")
+	}
+}
+
+func TestCompilePatternStripsXFlag(t *testing.T) {
+	pattern := compilePattern("a  b  # comment\n", "ix")
+	if _, err := regexp.Compile(pattern); err != nil {
+		t.Fatalf("compiling %q: %v", pattern, err)
+	}
+	rx := regexp.MustCompile(pattern)
+	if !rx.MatchString("AB") {
+		t.Errorf("pattern %q should match %q", pattern, "AB")
+	}
+}
+
+func TestCompilePatternWithoutXFlagKeepsWhitespace(t *testing.T) {
+	pattern := compilePattern("a b", "")
+	if pattern != "a b" {
+		t.Errorf("compilePattern: got %q, want %q", pattern, "a b")
+	}
+}